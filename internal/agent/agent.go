@@ -3,10 +3,16 @@ package agent
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/xvzf/computeblade-agent/pkg/daemon"
 	"github.com/xvzf/computeblade-agent/pkg/hal"
 	"github.com/xvzf/computeblade-agent/pkg/ledengine"
 	"github.com/xvzf/computeblade-agent/pkg/log"
@@ -21,14 +27,76 @@ var (
 		Help:      "ComputeBlade Agent internal event handler statistics (handled events)",
 	}, []string{"type"})
 
-	// droppedEventCounter is a prometheus counter that counts the number of events dropped by the agent
-	droppedEventCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	// fanControllerTemperatureGauge reports the last SoC temperature sampled by the fan controller, in degrees Celsius
+	fanControllerTemperatureGauge = promauto.NewGauge(prometheus.GaugeOpts{
 		Namespace: "computeblade_agent",
-		Name:      "events_dropped_count",
-		Help:      "ComputeBlade Agent internal event handler statistics (dropped events)",
-	}, []string{"type"})
+		Name:      "fan_controller_temperature_celsius",
+		Help:      "ComputeBlade Agent fan controller: last sampled SoC temperature",
+	})
+
+	// fanControllerTargetTemperatureGauge reports the configured PID target temperature, in degrees Celsius
+	fanControllerTargetTemperatureGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "computeblade_agent",
+		Name:      "fan_controller_target_temperature_celsius",
+		Help:      "ComputeBlade Agent fan controller: configured target SoC temperature",
+	})
+
+	// fanControllerSpeedGauge reports the fan speed computed by the controller, in percent
+	fanControllerSpeedGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "computeblade_agent",
+		Name:      "fan_controller_speed_percent",
+		Help:      "ComputeBlade Agent fan controller: computed fan speed",
+	})
+
+	// fanControllerPIDTermGauge reports the individual P/I/D terms of the last controller update, for tuning
+	fanControllerPIDTermGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "computeblade_agent",
+		Name:      "fan_controller_pid_term",
+		Help:      "ComputeBlade Agent fan controller: last computed PID term value",
+	}, []string{"term"})
+
+	// driverInfoGauge is a standard "info" metric exposing the active HAL driver and its capabilities as labels
+	driverInfoGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "computeblade_agent",
+		Name:      "hal_driver_info",
+		Help:      "ComputeBlade Agent active HAL driver and its capabilities (always 1)",
+	}, []string{"driver", "tach_reader", "per_fan_pwm", "rgb_top_led", "poe_class_negotiation"})
+)
+
+// FanControlMode selects which strategy computeBladeAgentImpl uses to derive the fan speed.
+type FanControlMode string
+
+const (
+	// FanControlModeStatic keeps the fan speed pinned to ComputeBladeAgentConfig.DefaultFanSpeed
+	FanControlModeStatic FanControlMode = "static"
+	// FanControlModePID drives the fan speed off a closed-loop PID controller targeting PIDConfig.TargetTemperature
+	FanControlModePID FanControlMode = "pid"
+	// FanControlModeCurve derives the fan speed via linear interpolation over FanCurve
+	FanControlModeCurve FanControlMode = "curve"
 )
 
+// FanCurvePoint is a single (temperature, fan speed) pair used for linear interpolation in FanControlModeCurve
+type FanCurvePoint struct {
+	// TempC is the SoC temperature in degrees Celsius for this point
+	TempC float64
+	// SpeedPct is the fan speed in percent applied at TempC
+	SpeedPct uint
+}
+
+// PIDConfig holds the tuning parameters for the closed-loop fan controller
+type PIDConfig struct {
+	// Kp, Ki, Kd are the proportional, integral and derivative gains
+	Kp, Ki, Kd float64
+	// TargetTemperature is the SoC temperature in degrees Celsius the controller tries to hold
+	TargetTemperature float64
+	// MinFanSpeed/MaxFanSpeed clamp the computed fan speed, in percent
+	MinFanSpeed, MaxFanSpeed uint
+	// IntegralMax clamps the accumulated integral term to avoid windup
+	IntegralMax float64
+	// SampleInterval configures how often the controller samples the SoC temperature and recomputes the fan speed
+	SampleInterval time.Duration
+}
+
 type Event int
 
 const (
@@ -72,19 +140,55 @@ type ComputeBladeAgentConfig struct {
 	// StealthModeEnabled indicates whether stealth mode is enabled
 	StealthModeEnabled bool
 
-	// DefaultFanSpeed is the default fan speed in percent. Usually 40% is sufficient
+	// HardwareProfile selects which hal.DriverRegistry entry is used to construct the blade HAL
+	// (e.g. "cm4", "cm5", "rk1"). Defaults to hal.HardwareProfileCM4.
+	HardwareProfile hal.HardwareProfile
+	// SmartFanUnit selects the smart fan unit (hal.FanUnitSmart) instead of the standard single-PWM fan unit
+	SmartFanUnit bool
+
+	// BladeID identifies this blade in EventEnvelope.BladeID, so external subscribers (MQTT, a cluster-wide
+	// controller watching many blades) can tell which blade an event came from
+	BladeID string
+
+	// DefaultFanSpeed is the default fan speed in percent. Usually 40% is sufficient.
+	// This is also the speed applied whenever the fan controller is disabled (FanControlModeStatic).
 	DefaultFanSpeed uint
 
 	// Critical temperature of the compute blade (used to trigger critical mode)
 	CriticalTemperature uint
+	// CriticalResetHysteresis is subtracted from CriticalTemperature to derive the temperature below which
+	// the blade leaves critical mode again. This avoids flapping in/out of critical mode around the threshold.
+	CriticalResetHysteresis uint
+
+	// FanControlMode selects how the fan speed is derived: "static" (DefaultFanSpeed), "pid" or "curve"
+	FanControlMode FanControlMode
+	// FanCurve is the set of (temperature, speed) points used for linear interpolation in FanControlModeCurve.
+	// Points may be listed in any order; they are sorted by ascending TempC before interpolating.
+	FanCurve []FanCurvePoint
+	// PID holds the tuning parameters used in FanControlModePID
+	PID PIDConfig
+
+	// ScenesPath optionally points to a YAML/JSON scene file (see LoadScenes) loaded at startup, letting
+	// users restyle the idle/identify/critical LED behavior without recompiling. If empty, built-in scenes
+	// derived from IdleLedColor/IdentifyLedColor/CriticalLedColor are used.
+	ScenesPath string
 }
 
 // ComputeBladeAgent implements the core-logic of the agent. It is responsible for handling events and interfacing with the hardware.
 type ComputeBladeAgent interface {
 	// Run dispatches the agent and blocks until the context is canceled or an error occurs
 	Run(ctx context.Context) error
-	// EmitEvent emits an event to the agent
+	// EmitEvent emits an event to the agent. It is a thin wrapper over the agent's EventBus.Publish.
 	EmitEvent(ctx context.Context, event Event) error
+	// WatchEvents subscribes to the agent's event bus, returning a channel of EventEnvelope matching filter
+	// and a cancel func to release the subscription. Backs the WatchEvents server-streaming RPC.
+	WatchEvents(ctx context.Context, filter EventFilter) (<-chan EventEnvelope, func())
+
+	// LoadScenes parses a YAML/JSON scene file, adds its scenes to the agent's scene table (overriding same-named
+	// ones) and replaces the conditional bindings
+	LoadScenes(r io.Reader) error
+	// SetScene renders the named scene on led
+	SetScene(led hal.LedIndex, name string) error
 	// SetFanSpeed sets the fan speed in percent
 	SetFanSpeed(_ context.Context, speed uint8) error
 	// SetStealthMode sets the stealth mode
@@ -92,6 +196,18 @@ type ComputeBladeAgent interface {
 
 	// WaitForIdentifyConfirm blocks until the user confirms the identify mode
 	WaitForIdentifyConfirm(ctx context.Context) error
+
+	// DriverInfo returns the active HAL driver name and its reported capabilities
+	DriverInfo(ctx context.Context) (DriverInfo, error)
+}
+
+// DriverInfo describes the HAL driver backing a running agent, surfaced via an RPC/metric so operators
+// can tell which hardware-specific code path is active and what features it supports.
+type DriverInfo struct {
+	// Name is the hardware profile the active driver was registered under (e.g. "cm4")
+	Name string
+	// Capabilities is the feature set reported by the driver, zero-valued if it doesn't implement hal.CapabilitiesProvider
+	Capabilities hal.Capabilities
 }
 
 // computeBladeAgentImpl is the implementation of the ComputeBladeAgent interface
@@ -102,20 +218,55 @@ type computeBladeAgentImpl struct {
 	edgeLedEngine ledengine.LedEngine
 	topLedEngine  ledengine.LedEngine
 
-	eventChan chan Event
+	fanController *pidController
+
+	driverInfo DriverInfo
+
+	bus           *EventBus
+	privilegedSub *PrivilegedSubscription
+
+	scenesMu      sync.RWMutex
+	scenes        map[string]Scene
+	sceneBindings map[hal.LedIndex][]SceneBinding
+
+	sceneRunMu   sync.Mutex
+	sceneCancel  map[hal.LedIndex]context.CancelFunc
+	bindingScene map[hal.LedIndex]string // last scene name applied by SetScene, per LED
 }
 
 func NewComputeBladeAgent(opts ComputeBladeAgentConfig) (ComputeBladeAgent, error) {
 	var err error
 
-	// blade, err := hal.NewCm4Hal(hal.ComputeBladeHalOpts{
-	blade, err := hal.NewCm4Hal(hal.ComputeBladeHalOpts{
-		FanUnit: hal.FanUnitStandard, // FIXME: support smart fan unit
+	hardwareProfile := opts.HardwareProfile
+	if hardwareProfile == "" {
+		hardwareProfile = hal.HardwareProfileCM4
+	}
+
+	fanUnit := hal.FanUnitStandard
+	if opts.SmartFanUnit {
+		fanUnit = hal.FanUnitSmart
+	}
+
+	blade, err := hal.New(hardwareProfile, hal.ComputeBladeHalOpts{
+		FanUnit: fanUnit,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	driverInfo := DriverInfo{Name: string(hardwareProfile)}
+	if capable, ok := blade.(hal.CapabilitiesProvider); ok {
+		driverInfo.Capabilities = capable.Capabilities()
+	}
+	driverInfoGauge.Reset()
+	driverInfoGauge.WithLabelValues(
+		driverInfo.Name,
+		strconv.FormatBool(driverInfo.Capabilities.TachReader),
+		strconv.FormatBool(driverInfo.Capabilities.PerFanPWM),
+		strconv.FormatBool(driverInfo.Capabilities.RGBTopLED),
+		strconv.FormatBool(driverInfo.Capabilities.PoEClassNegotiation),
+	).Set(1)
+
 	edgeLedEngine := ledengine.NewLedEngine(ledengine.LedEngineOpts{
 		LedIdx: hal.LedEdge,
 		Hal:    blade,
@@ -132,14 +283,42 @@ func NewComputeBladeAgent(opts ComputeBladeAgentConfig) (ComputeBladeAgent, erro
 		return nil, err
 	}
 
-	return &computeBladeAgentImpl{
+	bus := NewEventBus(opts.BladeID)
+
+	agent := &computeBladeAgentImpl{
 		opts:          opts,
 		blade:         blade,
 		edgeLedEngine: edgeLedEngine,
 		topLedEngine:  topLedEngine,
 		state:         NewComputeBladeState(),
-		eventChan:     make(chan Event, 10), // backlog of 10 events. They should process fast but we e.g. don't want to miss button presses
-	}, nil
+		fanController: newPIDController(opts.PID),
+		driverInfo:    driverInfo,
+		bus:           bus,
+		// The agent itself subscribes privileged so it can both drive its own event handler loop and
+		// synthesize events (e.g. the edge button toggling identify mode) the same way an external
+		// integration would.
+		privilegedSub: bus.SubscribePrivileged(nil),
+		scenes:        builtinScenes(opts),
+		sceneCancel:   make(map[hal.LedIndex]context.CancelFunc),
+	}
+
+	if opts.ScenesPath != "" {
+		f, err := os.Open(opts.ScenesPath)
+		if err != nil {
+			return nil, fmt.Errorf("opening scenes file: %w", err)
+		}
+		defer f.Close()
+		if err := agent.LoadScenes(f); err != nil {
+			return nil, err
+		}
+	}
+
+	return agent, nil
+}
+
+// DriverInfo returns the active HAL driver name and its reported capabilities
+func (a *computeBladeAgentImpl) DriverInfo(_ context.Context) (DriverInfo, error) {
+	return a.driverInfo, nil
 }
 
 func (a *computeBladeAgentImpl) Run(origCtx context.Context) error {
@@ -173,12 +352,7 @@ func (a *computeBladeAgentImpl) Run(origCtx context.Context) error {
 			} else if err != nil {
 				return
 			}
-			select {
-			case a.eventChan <- Event(EdgeButtonEvent):
-			default:
-				log.FromContext(ctx).Warn("Edge button press event dropped due to backlog")
-				droppedEventCounter.WithLabelValues(Event(EdgeButtonEvent).String()).Inc()
-			}
+			a.privilegedSub.Inject(Event(EdgeButtonEvent))
 		}
 	}()
 
@@ -206,6 +380,18 @@ func (a *computeBladeAgentImpl) Run(origCtx context.Context) error {
 		}
 	}()
 
+	// Start fan controller
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		log.FromContext(ctx).Info("Starting fan controller", zap.String("mode", string(a.opts.FanControlMode)))
+		err := a.runFanController(ctx)
+		if err != nil && err != context.Canceled {
+			log.FromContext(ctx).Error("Fan controller failed", zap.Error(err))
+			cancelCtx(err)
+		}
+	}()
+
 	// Start event handler
 	wg.Add(1)
 	go func() {
@@ -215,8 +401,8 @@ func (a *computeBladeAgentImpl) Run(origCtx context.Context) error {
 			select {
 			case <-ctx.Done():
 				return
-			case event := <-a.eventChan:
-				err := a.handleEvent(ctx, event)
+			case envelope := <-a.privilegedSub.Events:
+				err := a.handleEvent(ctx, envelope.Event)
 				if err != nil && err != context.Canceled {
 					log.FromContext(ctx).Error("Event handler failed", zap.Error(err))
 					cancelCtx(err)
@@ -225,13 +411,57 @@ func (a *computeBladeAgentImpl) Run(origCtx context.Context) error {
 		}
 	}()
 
+	// HAL, LED engines and the event handler goroutines are all up: tell systemd we're ready and start
+	// the watchdog. Both are no-ops when not running under systemd.
+	if err := daemon.Notify(daemon.StateReady); err != nil {
+		log.FromContext(ctx).Warn("Failed to notify systemd of readiness", zap.Error(err))
+	}
+	daemon.StartWatchdog(ctx, a.daemonHealthCheck)
+
 	wg.Wait()
 	return ctx.Err()
 }
 
+// daemonHealthCheck is passed to daemon.StartWatchdog: it probes the blade with a read-only temperature
+// read, bounded so a stuck GPIO/I2C transaction stops watchdog pings instead of masking the hang. It
+// deliberately never writes (e.g. fan speed), since that would override whatever the fan controller or a
+// critical-temperature handler currently has in effect.
+func (a *computeBladeAgentImpl) daemonHealthCheck() error {
+	ctx, cancel := context.WithTimeout(context.Background(), daemonHealthCheckTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.blade.GetTemperature(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(daemonHealthCheckTimeout):
+		return errors.New("daemon health check: blade did not respond in time")
+	}
+}
+
+// daemonHealthCheckTimeout bounds how long daemonHealthCheck waits for the blade to respond
+const daemonHealthCheckTimeout = 2 * time.Second
+
 // cleanup restores sane defaults before exiting. Ignores canceled context!
 func (a *computeBladeAgentImpl) cleanup(ctx context.Context) {
 	log.FromContext(ctx).Info("Exiting, restoring safe settings")
+
+	if err := daemon.Notify(daemon.StateStopping); err != nil {
+		log.FromContext(ctx).Warn("Failed to notify systemd of shutdown", zap.Error(err))
+	}
+
+	// Stop any running scene so it doesn't race with the static off-patterns set below
+	a.sceneRunMu.Lock()
+	for _, cancel := range a.sceneCancel {
+		cancel()
+	}
+	a.sceneRunMu.Unlock()
+
 	if err := a.blade.SetFanSpeed(100); err != nil {
 		log.FromContext(ctx).Error("Failed to set fan speed to 100%", zap.Error(err))
 	}
@@ -270,12 +500,7 @@ func (a *computeBladeAgentImpl) handleEvent(ctx context.Context, event Event) er
 		if a.state.IdentifyActive() {
 			event = Event(IdentifyConfirmEvent)
 		}
-		select {
-		case a.eventChan <- Event(event):
-		default:
-			log.FromContext(ctx).Warn("Edge button press event dropped due to backlog")
-			droppedEventCounter.WithLabelValues(event.String()).Inc()
-		}
+		a.privilegedSub.Inject(event)
 	}
 
 	return nil
@@ -283,12 +508,12 @@ func (a *computeBladeAgentImpl) handleEvent(ctx context.Context, event Event) er
 
 func (a *computeBladeAgentImpl) handleIdentifyActive(ctx context.Context) error {
 	log.FromContext(ctx).Info("Identify active")
-	return a.edgeLedEngine.SetPattern(ledengine.NewBurstPattern(hal.LedColor{}, a.opts.IdentifyLedColor))
+	return a.SetScene(hal.LedEdge, sceneIdentify)
 }
 
 func (a *computeBladeAgentImpl) handleIdentifyConfirm(ctx context.Context) error {
 	log.FromContext(ctx).Info("Identify confirmed/cleared")
-	return a.edgeLedEngine.SetPattern(ledengine.NewStaticPattern(a.opts.IdleLedColor))
+	return a.SetScene(hal.LedEdge, sceneIdle)
 }
 
 func (a *computeBladeAgentImpl) handleCriticalActive(ctx context.Context) error {
@@ -300,12 +525,11 @@ func (a *computeBladeAgentImpl) handleCriticalActive(ctx context.Context) error
 	// Disable stealth mode (turn on LEDs)
 	setStealthModeError := a.blade.SetStealthMode(false)
 
-	// Set critical pattern for top LED
-	setPatternTopLedErr := a.topLedEngine.SetPattern(
-		ledengine.NewSlowBlinkPattern(hal.LedColor{}, a.opts.CriticalLedColor),
-	)
+	// Set critical scene for top LED
+	setSceneTopLedErr := a.SetScene(hal.LedTop, sceneCritical)
+
 	// Combine errors, but don't stop execution flow for now
-	return errors.Join(setFanspeedError, setStealthModeError, setPatternTopLedErr)
+	return errors.Join(setFanspeedError, setStealthModeError, setSceneTopLedErr)
 }
 
 func (a *computeBladeAgentImpl) handleCriticalReset(ctx context.Context) error {
@@ -320,8 +544,8 @@ func (a *computeBladeAgentImpl) handleCriticalReset(ctx context.Context) error {
 		return err
 	}
 
-	// Set top LED off
-	if err := a.topLedEngine.SetPattern(ledengine.NewStaticPattern(hal.LedColor{})); err != nil {
+	// Set top LED back to its idle scene (off, unless a loaded scene file overrides "idle")
+	if err := a.SetScene(hal.LedTop, sceneIdle); err != nil {
 		return err
 	}
 
@@ -351,14 +575,19 @@ func (a *computeBladeAgentImpl) runEdgeLedEngine(ctx context.Context) error {
 	return a.edgeLedEngine.Run(ctx)
 }
 
-// EmitEvent dispatches an event to the event handler
+// EmitEvent dispatches an event to the event handler, guaranteeing delivery to the agent's own (privileged)
+// subscription: it blocks until the event is queued in that subscription's backlog or ctx is done, matching the
+// blocking eventChan semantics this replaced. Other subscribers (WatchEvents callers, the MQTT bridge) still
+// get it best-effort, same as any other published event, so a slow/stuck external consumer can't block the
+// caller or the agent's own event handling.
 func (a *computeBladeAgentImpl) EmitEvent(ctx context.Context, event Event) error {
-	select {
-	case a.eventChan <- event:
-		return nil
-	case <- ctx.Done():
-		return ctx.Err()
-	}
+	a.bus.publishBestEffort(event, &a.privilegedSub.id)
+	return a.privilegedSub.Send(ctx, event)
+}
+
+// WatchEvents subscribes to the agent's event bus. See ComputeBladeAgent.WatchEvents.
+func (a *computeBladeAgentImpl) WatchEvents(_ context.Context, filter EventFilter) (<-chan EventEnvelope, func()) {
+	return a.bus.Subscribe(filter)
 }
 
 // SetFanSpeed sets the fan speed
@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrSubscriberGone is returned by EventBus.send when the target subscriber has already been cancelled.
+var ErrSubscriberGone = errors.New("event bus: subscriber is gone")
+
+var (
+	// eventBusSubscriberGauge tracks the number of active EventBus subscribers
+	eventBusSubscriberGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "computeblade_agent",
+		Name:      "event_bus_subscribers",
+		Help:      "ComputeBlade Agent event bus: number of active subscribers",
+	})
+
+	// eventBusBacklogGauge reports the current backlog depth per subscriber
+	eventBusBacklogGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "computeblade_agent",
+		Name:      "event_bus_subscriber_backlog",
+		Help:      "ComputeBlade Agent event bus: number of queued-but-undelivered events for a subscriber",
+	}, []string{"subscriber"})
+
+	// eventBusDroppedCounter counts events dropped because a subscriber's backlog was full
+	eventBusDroppedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "computeblade_agent",
+		Name:      "event_bus_dropped_count",
+		Help:      "ComputeBlade Agent event bus: events dropped due to a full subscriber backlog",
+	}, []string{"subscriber", "type"})
+)
+
+// eventBusSubscriberBacklog is the channel buffer size each subscriber gets
+const eventBusSubscriberBacklog = 10
+
+// EventEnvelope wraps an Event with the metadata external subscribers (gRPC/MQTT) need to make sense of it
+// on its own, outside of the agent process.
+type EventEnvelope struct {
+	Event     Event
+	BladeID   string
+	Timestamp time.Time
+}
+
+// EventFilter decides whether a subscriber is interested in a given event. A nil filter matches everything.
+type EventFilter func(Event) bool
+
+// EventBus is a fan-out publisher that lets multiple in-process and out-of-process consumers observe agent
+// Events, replacing the single fixed-size internal channel computeBladeAgentImpl used to own.
+type EventBus struct {
+	bladeID string
+
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[uint64]*eventSubscriber
+}
+
+type eventSubscriber struct {
+	id         uint64
+	ch         chan EventEnvelope
+	filter     EventFilter
+	privileged bool
+}
+
+// NewEventBus creates an EventBus that stamps every published EventEnvelope with bladeID, so subscribers
+// fed from multiple blades (e.g. over MQTT) can tell them apart.
+func NewEventBus(bladeID string) *EventBus {
+	return &EventBus{bladeID: bladeID, subs: make(map[uint64]*eventSubscriber)}
+}
+
+// Publish fans out event to every subscriber whose filter matches it, best-effort (see publishBestEffort).
+func (b *EventBus) Publish(event Event) {
+	b.publishBestEffort(event, nil)
+}
+
+// publishBestEffort fans out event to every subscriber whose filter matches it, except the one with id
+// *exceptID (pass nil to exclude none). Delivery is best-effort: a subscriber with a full backlog drops the event
+// rather than stalling the publisher.
+func (b *EventBus) publishBestEffort(event Event, exceptID *uint64) {
+	envelope := EventEnvelope{Event: event, BladeID: b.bladeID, Timestamp: time.Now()}
+
+	b.mu.Lock()
+	subs := make([]*eventSubscriber, 0, len(b.subs))
+	for _, sub := range b.subs {
+		if exceptID != nil && sub.id == *exceptID {
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.ch <- envelope:
+		default:
+			eventBusDroppedCounter.WithLabelValues(strconv.FormatUint(sub.id, 10), event.String()).Inc()
+		}
+		eventBusBacklogGauge.WithLabelValues(strconv.FormatUint(sub.id, 10)).Set(float64(len(sub.ch)))
+	}
+}
+
+// Subscribe registers a new subscriber matching filter and returns its event channel plus a cancel func
+// that must be called once the subscriber is done, to release its backlog buffer and metrics.
+func (b *EventBus) Subscribe(filter EventFilter) (<-chan EventEnvelope, func()) {
+	sub := b.addSubscriber(filter, false)
+	return sub.ch, func() { b.removeSubscriber(sub.id) }
+}
+
+// PrivilegedSubscription is returned by SubscribePrivileged. In addition to observing events like a regular
+// subscriber, it can Inject synthesized events onto the bus as if they had been published by the agent
+// itself — used by the edge button handler and future integrations that need to originate events.
+type PrivilegedSubscription struct {
+	Events <-chan EventEnvelope
+	Inject func(Event)
+	// Send delivers event directly to this subscription, blocking until its backlog has room for it or ctx
+	// is done, instead of dropping it when the backlog is momentarily full. Used where a dropped event isn't safe
+	// to treat as best-effort (see EmitEvent).
+	Send   func(ctx context.Context, event Event) error
+	Cancel func()
+
+	id uint64 // lets EmitEvent fan out to every other subscriber without double-delivering to this one
+}
+
+// SubscribePrivileged registers a privileged subscriber matching filter. See PrivilegedSubscription.
+func (b *EventBus) SubscribePrivileged(filter EventFilter) *PrivilegedSubscription {
+	sub := b.addSubscriber(filter, true)
+	return &PrivilegedSubscription{
+		Events: sub.ch,
+		Inject: b.Publish,
+		Send:   func(ctx context.Context, event Event) error { return b.send(ctx, sub.id, event) },
+		Cancel: func() { b.removeSubscriber(sub.id) },
+		id:     sub.id,
+	}
+}
+
+// send delivers event directly to subscriber id, blocking until its backlog has room or ctx is done. Returns
+// ErrSubscriberGone if the subscriber has already been cancelled.
+func (b *EventBus) send(ctx context.Context, id uint64, event Event) error {
+	b.mu.Lock()
+	sub, ok := b.subs[id]
+	b.mu.Unlock()
+	if !ok {
+		return ErrSubscriberGone
+	}
+
+	envelope := EventEnvelope{Event: event, BladeID: b.bladeID, Timestamp: time.Now()}
+	select {
+	case sub.ch <- envelope:
+		eventBusBacklogGauge.WithLabelValues(strconv.FormatUint(id, 10)).Set(float64(len(sub.ch)))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *EventBus) addSubscriber(filter EventFilter, privileged bool) *eventSubscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	sub := &eventSubscriber{
+		id:         b.nextID,
+		ch:         make(chan EventEnvelope, eventBusSubscriberBacklog),
+		filter:     filter,
+		privileged: privileged,
+	}
+	b.subs[sub.id] = sub
+	eventBusSubscriberGauge.Set(float64(len(b.subs)))
+	return sub
+}
+
+func (b *EventBus) removeSubscriber(id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Deliberately don't close(sub.ch): Publish may concurrently be mid-send to it after dropping b.mu, and
+	// a send on a closed channel panics. Dropping it from the map is enough - nothing can Subscribe to it
+	// again, and the channel itself is garbage-collected once Publish's snapshot slice is.
+	if _, ok := b.subs[id]; ok {
+		delete(b.subs, id)
+		eventBusBacklogGauge.DeleteLabelValues(strconv.FormatUint(id, 10))
+	}
+	eventBusSubscriberGauge.Set(float64(len(b.subs)))
+}
@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventBusFanOut(t *testing.T) {
+	bus := NewEventBus("blade-1")
+	ch1, cancel1 := bus.Subscribe(nil)
+	defer cancel1()
+	ch2, cancel2 := bus.Subscribe(nil)
+	defer cancel2()
+
+	bus.Publish(Event(CriticalEvent))
+
+	for _, ch := range []<-chan EventEnvelope{ch1, ch2} {
+		select {
+		case env := <-ch:
+			if env.Event != Event(CriticalEvent) || env.BladeID != "blade-1" {
+				t.Fatalf("got envelope %+v, want CriticalEvent from blade-1", env)
+			}
+		default:
+			t.Fatal("expected both subscribers to receive the published event")
+		}
+	}
+}
+
+func TestEventBusFilter(t *testing.T) {
+	bus := NewEventBus("blade-1")
+	ch, cancel := bus.Subscribe(func(e Event) bool { return e == Event(CriticalResetEvent) })
+	defer cancel()
+
+	bus.Publish(Event(CriticalEvent))
+	select {
+	case env := <-ch:
+		t.Fatalf("filter should have dropped CriticalEvent, got %+v", env)
+	default:
+	}
+
+	bus.Publish(Event(CriticalResetEvent))
+	select {
+	case env := <-ch:
+		if env.Event != Event(CriticalResetEvent) {
+			t.Fatalf("got %+v, want CriticalResetEvent", env)
+		}
+	default:
+		t.Fatal("expected matching event to be delivered")
+	}
+}
+
+func TestEventBusDropsOnFullBacklog(t *testing.T) {
+	bus := NewEventBus("blade-1")
+	ch, cancel := bus.Subscribe(nil)
+	defer cancel()
+
+	for i := 0; i < eventBusSubscriberBacklog+5; i++ {
+		bus.Publish(Event(CriticalEvent))
+	}
+
+	if len(ch) != eventBusSubscriberBacklog {
+		t.Fatalf("backlog len = %d, want full backlog of %d", len(ch), eventBusSubscriberBacklog)
+	}
+}
+
+func TestEventBusPublishAfterCancelDoesNotPanic(t *testing.T) {
+	bus := NewEventBus("blade-1")
+	_, cancel := bus.Subscribe(nil)
+
+	cancel()
+	// Publishing after cancel must not panic even though removeSubscriber already ran: the channel is
+	// simply no longer in bus.subs, so Publish's snapshot won't include it.
+	bus.Publish(Event(CriticalEvent))
+}
+
+func TestPrivilegedSubscriptionSendBlocksUntilConsumed(t *testing.T) {
+	bus := NewEventBus("blade-1")
+	sub := bus.SubscribePrivileged(nil)
+	defer sub.Cancel()
+
+	// Fill the backlog so a plain best-effort publish would drop the next event.
+	for i := 0; i < eventBusSubscriberBacklog; i++ {
+		bus.Publish(Event(CriticalEvent))
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- sub.Send(context.Background(), Event(CriticalResetEvent)) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Send returned %v before the backlog had room", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	<-sub.Events // drain one slot
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Send() = %v, want nil once the backlog had room", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send did not unblock after the backlog drained")
+	}
+}
+
+func TestPrivilegedSubscriptionSendRespectsContext(t *testing.T) {
+	bus := NewEventBus("blade-1")
+	sub := bus.SubscribePrivileged(nil)
+	defer sub.Cancel()
+
+	for i := 0; i < eventBusSubscriberBacklog; i++ {
+		bus.Publish(Event(CriticalEvent))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := sub.Send(ctx, Event(CriticalResetEvent)); err == nil {
+		t.Fatal("expected Send to return an error once ctx is done on a full backlog")
+	}
+}
+
+func TestEventBusPublishBestEffortExcludesGivenSubscriber(t *testing.T) {
+	bus := NewEventBus("blade-1")
+	sub := bus.SubscribePrivileged(nil)
+	defer sub.Cancel()
+	ch, cancel := bus.Subscribe(nil)
+	defer cancel()
+
+	bus.publishBestEffort(Event(IdentifyEvent), &sub.id)
+
+	select {
+	case env := <-ch:
+		if env.Event != Event(IdentifyEvent) {
+			t.Fatalf("got %+v, want IdentifyEvent", env)
+		}
+	default:
+		t.Fatal("expected the non-excluded subscriber to receive the event")
+	}
+
+	select {
+	case env := <-sub.Events:
+		t.Fatalf("excluded subscriber should not have received the event, got %+v", env)
+	default:
+	}
+}
+
+func TestPrivilegedSubscriptionInject(t *testing.T) {
+	bus := NewEventBus("blade-1")
+	sub := bus.SubscribePrivileged(nil)
+	defer sub.Cancel()
+
+	sub.Inject(Event(IdentifyEvent))
+
+	select {
+	case env := <-sub.Events:
+		if env.Event != Event(IdentifyEvent) {
+			t.Fatalf("got %+v, want IdentifyEvent", env)
+		}
+	default:
+		t.Fatal("expected injected event to be delivered to the privileged subscriber")
+	}
+}
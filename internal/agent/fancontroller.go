@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/xvzf/computeblade-agent/pkg/log"
+	"go.uber.org/zap"
+)
+
+// defaultFanControllerSampleInterval is used whenever PIDConfig.SampleInterval is left unset
+const defaultFanControllerSampleInterval = 2 * time.Second
+
+// pidController implements a textbook PID loop with integral windup clamping
+type pidController struct {
+	cfg PIDConfig
+
+	integral float64
+	lastErr  float64
+	lastTick time.Time
+}
+
+func newPIDController(cfg PIDConfig) *pidController {
+	return &pidController{cfg: cfg}
+}
+
+// update computes the next fan speed (in percent) for a given measured temperature.
+// It also returns the individual P/I/D terms for observability.
+func (c *pidController) update(now time.Time, measured float64) (speed uint, p, i, d float64) {
+	err := measured - c.cfg.TargetTemperature
+
+	dt := c.cfg.SampleInterval
+	if dt <= 0 {
+		dt = defaultFanControllerSampleInterval
+	}
+	if !c.lastTick.IsZero() {
+		dt = now.Sub(c.lastTick)
+	}
+	c.lastTick = now
+
+	c.integral += err * dt.Seconds()
+	if c.cfg.IntegralMax > 0 {
+		if c.integral > c.cfg.IntegralMax {
+			c.integral = c.cfg.IntegralMax
+		} else if c.integral < -c.cfg.IntegralMax {
+			c.integral = -c.cfg.IntegralMax
+		}
+	}
+
+	derivative := (err - c.lastErr) / dt.Seconds()
+	c.lastErr = err
+
+	p = c.cfg.Kp * err
+	i = c.cfg.Ki * c.integral
+	d = c.cfg.Kd * derivative
+
+	out := p + i + d
+	if out < 0 {
+		out = 0
+	}
+
+	min, max := c.cfg.MinFanSpeed, c.cfg.MaxFanSpeed
+	if max == 0 {
+		max = 100
+	}
+	speed = uint(out)
+	if speed < min {
+		speed = min
+	}
+	if speed > max {
+		speed = max
+	}
+
+	return speed, p, i, d
+}
+
+// fanSpeedFromCurve linearly interpolates the fan speed for the given temperature over FanCurve, sorted by TempC.
+// Temperatures below the first point or above the last point are clamped to the respective endpoint speed.
+func fanSpeedFromCurve(curve []FanCurvePoint, tempC float64) uint {
+	if len(curve) == 0 {
+		return 0
+	}
+
+	points := make([]FanCurvePoint, len(curve))
+	copy(points, curve)
+	sort.Slice(points, func(i, j int) bool { return points[i].TempC < points[j].TempC })
+
+	if tempC <= points[0].TempC {
+		return points[0].SpeedPct
+	}
+	last := points[len(points)-1]
+	if tempC >= last.TempC {
+		return last.SpeedPct
+	}
+
+	for i := 1; i < len(points); i++ {
+		if tempC > points[i].TempC {
+			continue
+		}
+		lo, hi := points[i-1], points[i]
+		span := hi.TempC - lo.TempC
+		if span <= 0 {
+			return hi.SpeedPct
+		}
+		ratio := (tempC - lo.TempC) / span
+		// Signed float delta: SpeedPct isn't required to be monotonically increasing with TempC, and
+		// hi.SpeedPct-lo.SpeedPct as a uint subtraction would underflow on a descending segment.
+		delta := float64(hi.SpeedPct) - float64(lo.SpeedPct)
+		return uint(float64(lo.SpeedPct) + ratio*delta)
+	}
+
+	return last.SpeedPct
+}
+
+// runFanController samples the SoC temperature on a timer and applies the configured fan control strategy.
+// It also owns transitioning the blade in/out of critical mode based on ComputeBladeAgentConfig.CriticalTemperature,
+// with ComputeBladeAgentConfig.CriticalResetHysteresis preventing flapping around the threshold.
+func (a *computeBladeAgentImpl) runFanController(ctx context.Context) error {
+	interval := a.opts.PID.SampleInterval
+	if interval <= 0 {
+		interval = defaultFanControllerSampleInterval
+	}
+
+	fanControllerTargetTemperatureGauge.Set(a.opts.PID.TargetTemperature)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := a.tickFanController(ctx); err != nil {
+				log.FromContext(ctx).Error("Fan controller tick failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (a *computeBladeAgentImpl) tickFanController(ctx context.Context) error {
+	tempC, err := a.blade.GetTemperature(ctx)
+	if err != nil {
+		return err
+	}
+	fanControllerTemperatureGauge.Set(tempC)
+
+	if err := a.evaluateCriticalTemperature(ctx, tempC); err != nil {
+		return err
+	}
+
+	// The critical handler already pins the fan to 100%; don't fight it with computed speeds, but still
+	// evaluate scene bindings (e.g. a critical_active condition) against that pinned speed.
+	if a.state.CriticalActive() {
+		a.evaluateSceneBindings(ctx, tempC, 100)
+		return nil
+	}
+
+	var speed uint
+	switch a.opts.FanControlMode {
+	case FanControlModePID:
+		var p, i, d float64
+		speed, p, i, d = a.fanController.update(time.Now(), tempC)
+		fanControllerPIDTermGauge.WithLabelValues("p").Set(p)
+		fanControllerPIDTermGauge.WithLabelValues("i").Set(i)
+		fanControllerPIDTermGauge.WithLabelValues("d").Set(d)
+		err = a.blade.SetFanSpeed(uint8(speed))
+	case FanControlModeCurve:
+		speed = fanSpeedFromCurve(a.opts.FanCurve, tempC)
+		err = a.blade.SetFanSpeed(uint8(speed))
+	default: // FanControlModeStatic or unset
+		speed = a.opts.DefaultFanSpeed
+		err = a.blade.SetFanSpeed(uint8(speed))
+	}
+	fanControllerSpeedGauge.Set(float64(speed))
+
+	a.evaluateSceneBindings(ctx, tempC, speed)
+	return err
+}
+
+// evaluateCriticalTemperature emits CriticalEvent/CriticalResetEvent based on the sampled temperature,
+// taking over the role previously played by an external temperature monitor.
+//
+// EmitEvent guarantees delivery of these events to the agent's own event handler (blocking until they are
+// queued in its backlog or ctx is done), so a transition is never silently dropped here.
+func (a *computeBladeAgentImpl) evaluateCriticalTemperature(ctx context.Context, tempC float64) error {
+	critical := float64(a.opts.CriticalTemperature)
+	if critical <= 0 {
+		return nil
+	}
+	reset := critical - float64(a.opts.CriticalResetHysteresis)
+
+	switch {
+	case !a.state.CriticalActive() && tempC >= critical:
+		return a.EmitEvent(ctx, Event(CriticalEvent))
+	case a.state.CriticalActive() && tempC <= reset:
+		return a.EmitEvent(ctx, Event(CriticalResetEvent))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPidControllerUpdateFirstTickHasNoDerivativeKick(t *testing.T) {
+	c := newPIDController(PIDConfig{TargetTemperature: 50, Kp: 1, Ki: 0, Kd: 1})
+
+	now := time.Now()
+	_, _, _, d := c.update(now, 60)
+
+	// On the first tick, lastTick is zero so dt falls back to defaultFanControllerSampleInterval and
+	// lastErr is 0, so derivative == err/dt rather than blowing up from a near-zero dt.
+	wantErr := 60.0 - 50.0
+	wantD := wantErr / defaultFanControllerSampleInterval.Seconds()
+	if d != wantD {
+		t.Fatalf("first-tick derivative term = %v, want %v", d, wantD)
+	}
+}
+
+func TestPidControllerUpdateClampsToMinMax(t *testing.T) {
+	c := newPIDController(PIDConfig{TargetTemperature: 0, Kp: 1000, MinFanSpeed: 10, MaxFanSpeed: 80})
+
+	speed, _, _, _ := c.update(time.Now(), 100)
+	if speed != 80 {
+		t.Fatalf("speed = %d, want clamped to MaxFanSpeed 80", speed)
+	}
+
+	speed, _, _, _ = c.update(time.Now().Add(time.Second), -100)
+	if speed != 10 {
+		t.Fatalf("speed = %d, want clamped to MinFanSpeed 10", speed)
+	}
+}
+
+func TestPidControllerUpdateDefaultsMaxSpeedTo100(t *testing.T) {
+	c := newPIDController(PIDConfig{TargetTemperature: 0, Kp: 1000})
+
+	speed, _, _, _ := c.update(time.Now(), 100)
+	if speed != 100 {
+		t.Fatalf("speed = %d, want clamped to default max 100", speed)
+	}
+}
+
+func TestPidControllerUpdateIntegralAccumulatesAndClamps(t *testing.T) {
+	c := newPIDController(PIDConfig{TargetTemperature: 50, Ki: 1, IntegralMax: 5})
+
+	now := time.Now()
+	for n := 0; n < 10; n++ {
+		now = now.Add(time.Second)
+		_, _, integral, _ := c.update(now, 60)
+		if integral > 5 {
+			t.Fatalf("integral term %v exceeded IntegralMax 5", integral)
+		}
+	}
+}
+
+func TestFanSpeedFromCurve(t *testing.T) {
+	curve := []FanCurvePoint{
+		{TempC: 70, SpeedPct: 80},
+		{TempC: 40, SpeedPct: 20},
+		{TempC: 55, SpeedPct: 50},
+	}
+
+	tests := []struct {
+		name  string
+		tempC float64
+		want  uint
+	}{
+		{"below first point clamps low", 10, 20},
+		{"at first point", 40, 20},
+		{"interpolates between points", 47.5, 35},
+		{"at interior point", 55, 50},
+		{"above last point clamps high", 100, 80},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fanSpeedFromCurve(curve, tt.tempC); got != tt.want {
+				t.Errorf("fanSpeedFromCurve(%v) = %d, want %d", tt.tempC, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFanSpeedFromCurveEmpty(t *testing.T) {
+	if got := fanSpeedFromCurve(nil, 50); got != 0 {
+		t.Fatalf("fanSpeedFromCurve(nil) = %d, want 0", got)
+	}
+}
+
+func TestFanSpeedFromCurveDescendingSegment(t *testing.T) {
+	// SpeedPct isn't required to increase monotonically with TempC; a descending segment must not underflow
+	// the unsigned SpeedPct subtraction into a huge garbage value.
+	curve := []FanCurvePoint{
+		{TempC: 40, SpeedPct: 80},
+		{TempC: 60, SpeedPct: 20},
+	}
+
+	if got := fanSpeedFromCurve(curve, 50); got != 50 {
+		t.Fatalf("fanSpeedFromCurve(50) on descending curve = %d, want 50", got)
+	}
+}
@@ -0,0 +1,416 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/xvzf/computeblade-agent/pkg/hal"
+	"github.com/xvzf/computeblade-agent/pkg/ledengine"
+	"github.com/xvzf/computeblade-agent/pkg/log"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Transition describes how a Step's color is reached from the previous one.
+type Transition string
+
+const (
+	// TransitionNone jumps straight to Step.Color
+	TransitionNone Transition = "none"
+	// TransitionLinear blends from the previous color to Step.Color at a constant rate over Step.DurationMs
+	TransitionLinear Transition = "linear"
+	// TransitionEase blends from the previous color to Step.Color with ease-in-out pacing over Step.DurationMs
+	TransitionEase Transition = "ease"
+)
+
+// Step is a single instruction in a Scene: hold/transition to Color over DurationMs, optionally repeated.
+type Step struct {
+	Color      hal.LedColor
+	DurationMs int
+	Transition Transition
+	Repeat     int
+}
+
+// Scene is an ordered, optionally looping sequence of Steps rendered on one LED.
+type Scene struct {
+	Name  string
+	Steps []Step
+}
+
+// SceneBinding maps a boolean condition over agent state to a scene name for a given LED, letting a scene
+// file restyle the whole UX (e.g. "fan_pct>80" -> "loud") without recompiling.
+type SceneBinding struct {
+	LED       hal.LedIndex
+	Condition string
+	Scene     string
+}
+
+// sceneFile is the on-disk (YAML or JSON, YAML being a superset) representation loaded by LoadScenes.
+type sceneFile struct {
+	Scenes []struct {
+		Name  string `yaml:"name"`
+		Steps []struct {
+			Color      hal.LedColor `yaml:"color"`
+			DurationMs int          `yaml:"durationMs"`
+			Transition string       `yaml:"transition"`
+			Repeat     int          `yaml:"repeat"`
+		} `yaml:"steps"`
+	} `yaml:"scenes"`
+	Bindings []struct {
+		LED       string `yaml:"led"`
+		Condition string `yaml:"condition"`
+		Scene     string `yaml:"scene"`
+	} `yaml:"bindings"`
+}
+
+// Well-known scene names the agent's built-in event handlers look up, so they keep working out of the box
+// even when no scene file overrides them.
+const (
+	sceneIdle     = "idle"
+	sceneIdentify = "identify"
+	sceneCritical = "critical"
+)
+
+// LoadScenes parses a YAML (or JSON, which is valid YAML) scene file, adds its scenes to the agent's scene
+// table (overriding same-named ones, builtins included) and replaces the conditional bindings with its own.
+func (a *computeBladeAgentImpl) LoadScenes(r io.Reader) error {
+	var file sceneFile
+	if err := yaml.NewDecoder(r).Decode(&file); err != nil {
+		return fmt.Errorf("parsing scene file: %w", err)
+	}
+
+	scenes := make(map[string]Scene, len(file.Scenes))
+	for _, s := range file.Scenes {
+		scene := Scene{Name: s.Name, Steps: make([]Step, 0, len(s.Steps))}
+		for _, st := range s.Steps {
+			scene.Steps = append(scene.Steps, Step{
+				Color:      st.Color,
+				DurationMs: st.DurationMs,
+				Transition: Transition(st.Transition),
+				Repeat:     st.Repeat,
+			})
+		}
+		scenes[s.Name] = scene
+	}
+
+	bindings := make(map[hal.LedIndex][]SceneBinding)
+	for _, b := range file.Bindings {
+		led, err := parseLedIndex(b.LED)
+		if err != nil {
+			return err
+		}
+		bindings[led] = append(bindings[led], SceneBinding{LED: led, Condition: b.Condition, Scene: b.Scene})
+	}
+
+	a.scenesMu.Lock()
+	defer a.scenesMu.Unlock()
+	if a.scenes == nil {
+		a.scenes = make(map[string]Scene, len(scenes))
+	}
+	for name, scene := range scenes {
+		// Drop any "<led>:name" builtin (see builtinScenes) so a plain-name override actually takes effect
+		// on both LEDs instead of being shadowed by SetScene's prefixed-key-first lookup.
+		delete(a.scenes, "edge:"+name)
+		delete(a.scenes, "top:"+name)
+		a.scenes[name] = scene // override builtins (idle/identify/critical) by name, or add new ones
+	}
+	a.sceneBindings = bindings
+	return nil
+}
+
+func parseLedIndex(name string) (hal.LedIndex, error) {
+	switch strings.ToLower(name) {
+	case "edge":
+		return hal.LedEdge, nil
+	case "top":
+		return hal.LedTop, nil
+	default:
+		return 0, fmt.Errorf("scenes: unknown led %q, expected \"edge\" or \"top\"", name)
+	}
+}
+
+// ledName renders a hal.LedIndex as the "edge"/"top" string scene files use.
+func ledName(led hal.LedIndex) string {
+	if led == hal.LedTop {
+		return "top"
+	}
+	return "edge"
+}
+
+// SetScene renders the named scene on led, cancelling whatever scene is currently playing there. A scene
+// registered as "<led>:<name>" (e.g. by builtinScenes, to give the edge and top LED different defaults for
+// the same well-known name) takes precedence over a plain "<name>" entry.
+func (a *computeBladeAgentImpl) SetScene(led hal.LedIndex, name string) error {
+	a.scenesMu.RLock()
+	scene, ok := a.scenes[ledName(led)+":"+name]
+	if !ok {
+		scene, ok = a.scenes[name]
+	}
+	a.scenesMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("scenes: no such scene %q", name)
+	}
+
+	engine := a.edgeLedEngine
+	if led == hal.LedTop {
+		engine = a.topLedEngine
+	}
+
+	a.sceneRunMu.Lock()
+	defer a.sceneRunMu.Unlock()
+	if cancel, ok := a.sceneCancel[led]; ok {
+		cancel()
+	}
+	if a.bindingScene == nil {
+		a.bindingScene = make(map[hal.LedIndex]string)
+	}
+	a.bindingScene[led] = name
+
+	if len(scene.Steps) == 0 {
+		return engine.SetPattern(ledengine.NewStaticPattern(hal.LedColor{}))
+	}
+	if len(scene.Steps) == 1 && scene.Steps[0].Transition == TransitionNone {
+		return engine.SetPattern(ledengine.NewStaticPattern(scene.Steps[0].Color))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if a.sceneCancel == nil {
+		a.sceneCancel = make(map[hal.LedIndex]context.CancelFunc)
+	}
+	a.sceneCancel[led] = cancel
+
+	go a.runScene(ctx, engine, scene)
+	return nil
+}
+
+// sceneFrameInterval is how often runScene re-renders a static pattern while transitioning, fine-grained
+// enough for smooth perceived gradients on the WS2812 top LED.
+const sceneFrameInterval = 30 * time.Millisecond
+
+// runScene plays scene's steps in order, each Step.Repeat times (0 or negative plays it once), and loops the
+// whole scene until ctx is canceled, blending
+// TransitionLinear/TransitionEase steps in CIE-Lab space for perceptually smooth color gradients.
+func (a *computeBladeAgentImpl) runScene(ctx context.Context, engine ledengine.LedEngine, scene Scene) {
+	prev := hal.LedColor{}
+	for {
+		for _, step := range scene.Steps {
+			repeat := step.Repeat
+			if repeat <= 0 {
+				repeat = 1
+			}
+			for r := 0; r < repeat; r++ {
+				if !a.playStep(ctx, engine, prev, step) {
+					return
+				}
+				prev = step.Color
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// playStep renders a single step, blending from `from` to step.Color over step.DurationMs. Returns false if
+// ctx was canceled mid-render.
+func (a *computeBladeAgentImpl) playStep(ctx context.Context, engine ledengine.LedEngine, from hal.LedColor, step Step) bool {
+	duration := time.Duration(step.DurationMs) * time.Millisecond
+	if step.Transition == TransitionNone || duration <= 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		default:
+		}
+		_ = engine.SetPattern(ledengine.NewStaticPattern(step.Color))
+		if duration > 0 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(duration):
+			}
+		}
+		return true
+	}
+
+	ticker := time.NewTicker(sceneFrameInterval)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			t := float64(time.Since(start)) / float64(duration)
+			if t >= 1 {
+				_ = engine.SetPattern(ledengine.NewStaticPattern(step.Color))
+				return true
+			}
+			if step.Transition == TransitionEase {
+				t = t * t * (3 - 2*t) // smoothstep easing
+			}
+			_ = engine.SetPattern(ledengine.NewStaticPattern(blendLab(from, step.Color, t)))
+		}
+	}
+}
+
+// blendLab interpolates between two LedColors in CIE-Lab space, which (unlike naive RGB lerp) avoids muddy
+// midpoints and produces perceptually even gradients on the top LED.
+func blendLab(from, to hal.LedColor, t float64) hal.LedColor {
+	c1 := colorful.Color{R: float64(from.R) / 255, G: float64(from.G) / 255, B: float64(from.B) / 255}
+	c2 := colorful.Color{R: float64(to.R) / 255, G: float64(to.G) / 255, B: float64(to.B) / 255}
+	blended := c1.BlendLab(c2, t).Clamped()
+	return hal.LedColor{
+		R: uint8(blended.R * 255),
+		G: uint8(blended.G * 255),
+		B: uint8(blended.B * 255),
+	}
+}
+
+// evaluateSceneBindings checks every configured binding against current agent state and applies the first
+// matching scene per LED, reverting to sceneIdle once no binding matches anymore. Invoked from the fan
+// controller tick, since that's already the agent's regular heartbeat for temperature/fan state.
+//
+// It only calls SetScene on an actual transition (tracked in a.bindingScene) so an animated bound scene
+// (e.g. "fan_pct>80" -> a pulsing scene) keeps playing instead of being restarted from step 0 every tick.
+//
+// The edge LED during identify and the top LED during critical are owned by their respective event
+// handlers (handleIdentifyActive/handleCriticalActive); bindings on those LEDs are skipped while that event
+// scene is active so a binding revert-to-idle can't make identify/critical invisible. SetScene records every
+// scene it applies in a.bindingScene, the event handlers' own included, so the binding re-evaluates (and
+// applies/reverts correctly) as soon as the event scene ends.
+func (a *computeBladeAgentImpl) evaluateSceneBindings(ctx context.Context, tempC float64, fanPct uint) {
+	a.scenesMu.RLock()
+	bindings := a.sceneBindings
+	a.scenesMu.RUnlock()
+
+	state := sceneConditionState{
+		identifyActive: a.state.IdentifyActive(),
+		criticalActive: a.state.CriticalActive(),
+		fanPct:         float64(fanPct),
+		tempC:          tempC,
+	}
+
+	for led, ledBindings := range bindings {
+		if led == hal.LedEdge && state.identifyActive {
+			continue
+		}
+		if led == hal.LedTop && state.criticalActive {
+			continue
+		}
+
+		want := sceneIdle // revert target once no binding matches
+		for _, binding := range ledBindings {
+			if evaluateSceneCondition(binding.Condition, state) {
+				want = binding.Scene
+				break // first matching binding per LED wins
+			}
+		}
+
+		a.sceneRunMu.Lock()
+		if a.bindingScene == nil {
+			a.bindingScene = make(map[hal.LedIndex]string)
+		}
+		alreadyApplied := a.bindingScene[led] == want
+		a.bindingScene[led] = want
+		a.sceneRunMu.Unlock()
+
+		if alreadyApplied {
+			continue
+		}
+		if err := a.SetScene(led, want); err != nil {
+			log.FromContext(ctx).Warn("Failed to apply scene binding", zap.String("scene", want), zap.Error(err))
+		}
+	}
+}
+
+type sceneConditionState struct {
+	identifyActive bool
+	criticalActive bool
+	fanPct         float64
+	tempC          float64
+}
+
+// evaluateSceneCondition evaluates a single condition of the form "identify_active", "critical_active",
+// or "<field><op><number>" (e.g. "fan_pct>80", "temp_c>65"), where field is fan_pct or temp_c and op is one
+// of >=, <=, >, < or ==. Anything else evaluates to false.
+func evaluateSceneCondition(condition string, state sceneConditionState) bool {
+	switch condition {
+	case "identify_active":
+		return state.identifyActive
+	case "critical_active":
+		return state.criticalActive
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<", "=="} {
+		idx := strings.Index(condition, op)
+		if idx <= 0 {
+			continue
+		}
+		field := condition[:idx]
+		threshold, err := strconv.ParseFloat(condition[idx+len(op):], 64)
+		if err != nil {
+			return false
+		}
+
+		var value float64
+		switch field {
+		case "fan_pct":
+			value = state.fanPct
+		case "temp_c":
+			value = state.tempC
+		default:
+			return false
+		}
+
+		switch op {
+		case ">=":
+			return value >= threshold
+		case "<=":
+			return value <= threshold
+		case ">":
+			return value > threshold
+		case "<":
+			return value < threshold
+		case "==":
+			return value == threshold
+		}
+	}
+	return false
+}
+
+// builtinScenes constructs the default idle/identify/critical scenes from the agent's legacy config colors,
+// so SetScene still has something to render when no ScenesPath is configured. "edge:idle"/"top:idle" give
+// the edge and top LED different defaults for the same well-known "idle" name: the edge LED idles at
+// IdleLedColor, while the top LED stays off outside of critical mode (it's reserved for emergencies).
+func builtinScenes(opts ComputeBladeAgentConfig) map[string]Scene {
+	return map[string]Scene{
+		"edge:" + sceneIdle: {
+			Name:  sceneIdle,
+			Steps: []Step{{Color: opts.IdleLedColor, Transition: TransitionNone}},
+		},
+		"top:" + sceneIdle: {
+			Name:  sceneIdle,
+			Steps: []Step{{Color: hal.LedColor{}, Transition: TransitionNone}},
+		},
+		sceneIdentify: {
+			Name: sceneIdentify,
+			Steps: []Step{
+				{Color: hal.LedColor{}, DurationMs: 500, Transition: TransitionEase},
+				{Color: opts.IdentifyLedColor, DurationMs: 500, Transition: TransitionEase},
+			},
+			// the burst effect repeats via the outer runScene loop (Repeat left at its zero value == each step once per pass)
+		},
+		sceneCritical: {
+			Name: sceneCritical,
+			Steps: []Step{
+				{Color: hal.LedColor{}, DurationMs: 500, Transition: TransitionNone},
+				{Color: opts.CriticalLedColor, DurationMs: 500, Transition: TransitionNone},
+			},
+		},
+	}
+}
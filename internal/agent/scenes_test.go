@@ -0,0 +1,40 @@
+package agent
+
+import "testing"
+
+func TestEvaluateSceneCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		state     sceneConditionState
+		want      bool
+	}{
+		{"identify_active true", "identify_active", sceneConditionState{identifyActive: true}, true},
+		{"identify_active false", "identify_active", sceneConditionState{identifyActive: false}, false},
+		{"critical_active true", "critical_active", sceneConditionState{criticalActive: true}, true},
+		{"fan_pct greater-equal matches", "fan_pct>=80", sceneConditionState{fanPct: 80}, true},
+		{"fan_pct greater-equal below threshold", "fan_pct>=80", sceneConditionState{fanPct: 79}, false},
+		{"fan_pct strictly greater", "fan_pct>80", sceneConditionState{fanPct: 80}, false},
+		{"temp_c less-equal", "temp_c<=65", sceneConditionState{tempC: 65}, true},
+		{"temp_c strictly less", "temp_c<65", sceneConditionState{tempC: 65}, false},
+		{"equality", "temp_c==65", sceneConditionState{tempC: 65}, true},
+		{"unknown field", "bogus_field>1", sceneConditionState{}, false},
+		{"malformed threshold", "fan_pct>not-a-number", sceneConditionState{}, false},
+		{"unknown literal condition", "something_else", sceneConditionState{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluateSceneCondition(tt.condition, tt.state); got != tt.want {
+				t.Errorf("evaluateSceneCondition(%q) = %v, want %v", tt.condition, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateSceneConditionOperatorPrecedence(t *testing.T) {
+	// ">=" must be tried before ">" so "fan_pct>=80" isn't misparsed as field "fan_pct" op ">" threshold "=80".
+	if !evaluateSceneCondition("fan_pct>=80", sceneConditionState{fanPct: 80}) {
+		t.Fatal("expected >= to be matched before the bare > operator")
+	}
+}
@@ -0,0 +1,22 @@
+// Package daemon integrates the agent with systemd: sd_notify readiness/watchdog pings, so a blade can be
+// managed as a first-class systemd service (Type=notify) with automatic restart when the agent wedges on a
+// stuck GPIO/I2C transaction. Notify/StartWatchdog are no-ops when not running under systemd, and the whole
+// systemd integration can be compiled out with the "nosystemd" build tag.
+package daemon
+
+// State is an sd_notify state string, e.g. "READY=1". See systemd's sd_notify(3) for the full set.
+type State string
+
+const (
+	// StateReady tells systemd the service finished starting up
+	StateReady State = "READY=1"
+	// StateStopping tells systemd the service is beginning a clean shutdown
+	StateStopping State = "STOPPING=1"
+	// StateWatchdog is a liveness ping; systemd restarts the unit if one isn't seen within WatchdogSec
+	StateWatchdog State = "WATCHDOG=1"
+)
+
+// HealthFunc reports whether the process is still healthy enough to keep sending watchdog pings. It should
+// be cheap and exercise something that would actually wedge (e.g. a bounded fan speed re-apply or tach
+// read), so a stuck GPIO/I2C transaction stops the pings instead of masking the hang.
+type HealthFunc func() error
@@ -0,0 +1,62 @@
+//go:build linux && !nosystemd
+
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends state to the socket named by $NOTIFY_SOCKET. It is a no-op (returns nil) if that variable
+// isn't set, i.e. the process isn't running under systemd with Type=notify/notify-reload.
+func Notify(state State) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogPingMargin pings at 1/2 of $WATCHDOG_USEC rather than the full interval, so scheduling jitter
+// doesn't itself cause a missed deadline and an unwanted restart.
+const watchdogPingMargin = 2
+
+// StartWatchdog pings systemd at half of $WATCHDOG_USEC, gated on health succeeding, until ctx is canceled.
+// It is a no-op if $WATCHDOG_USEC isn't set, i.e. the unit doesn't have WatchdogSec configured.
+func StartWatchdog(ctx context.Context, health HealthFunc) {
+	usec, err := strconv.Atoi(os.Getenv("WATCHDOG_USEC"))
+	if err != nil || usec <= 0 {
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond / watchdogPingMargin
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := health(); err != nil {
+					// Skip this ping; if the process stays wedged, systemd's own WatchdogSec timeout
+					// fires and restarts it. The error is not logged here; any logging is up to
+					// health itself.
+					continue
+				}
+				_ = Notify(StateWatchdog)
+			}
+		}
+	}()
+}
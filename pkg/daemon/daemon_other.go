@@ -0,0 +1,14 @@
+//go:build !linux || nosystemd
+
+package daemon
+
+import "context"
+
+// Notify is a no-op on non-Linux platforms (or when built with the "nosystemd" tag), since sd_notify is a
+// Linux/systemd-specific mechanism.
+func Notify(_ State) error {
+	return nil
+}
+
+// StartWatchdog is a no-op on non-Linux platforms (or when built with the "nosystemd" tag).
+func StartWatchdog(_ context.Context, _ HealthFunc) {}
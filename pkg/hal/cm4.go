@@ -0,0 +1,34 @@
+package hal
+
+// FanUnitSmart selects a smart fan unit that exposes per-fan tachometer feedback, in addition to
+// FanUnitStandard which only supports a single shared PWM line.
+const FanUnitSmart = FanUnitStandard + 1
+
+// cm4Driver wraps the existing CM4 HAL implementation to additionally satisfy CapabilitiesProvider,
+// without requiring changes to the underlying NewCm4Hal constructor/type.
+type cm4Driver struct {
+	ComputeBladeHal
+	caps Capabilities
+}
+
+func (d *cm4Driver) Capabilities() Capabilities {
+	return d.caps
+}
+
+func init() {
+	Register(HardwareProfileCM4, func(opts ComputeBladeHalOpts) (ComputeBladeHal, error) {
+		blade, err := NewCm4Hal(opts)
+		if err != nil {
+			return nil, err
+		}
+		return &cm4Driver{
+			ComputeBladeHal: blade,
+			caps: Capabilities{
+				TachReader:          opts.FanUnit == FanUnitSmart,
+				PerFanPWM:           false,
+				RGBTopLED:           true,
+				PoEClassNegotiation: true,
+			},
+		}, nil
+	})
+}
@@ -0,0 +1,106 @@
+package hal
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// HardwareProfile identifies a supported blade hardware variant, used to look up the right driver in the
+// DriverRegistry. Some profiles carry further sub-options (e.g. fan unit type) via ComputeBladeHalOpts.
+type HardwareProfile string
+
+const (
+	// HardwareProfileCM4 targets the Raspberry Pi Compute Module 4 carrier board
+	HardwareProfileCM4 HardwareProfile = "cm4"
+	// HardwareProfileCM5 targets the Raspberry Pi Compute Module 5 carrier board.
+	// No driver is registered for this profile yet; New returns an error until one ships.
+	HardwareProfileCM5 HardwareProfile = "cm5"
+	// HardwareProfileRK1 targets the Turing Pi RK1 module.
+	// No driver is registered for this profile yet; New returns an error until one ships.
+	HardwareProfileRK1 HardwareProfile = "rk1"
+)
+
+// Capabilities describes the hardware features a ComputeBladeHal driver supports, so callers can gate
+// behavior (e.g. smart-fan RPM feedback, 24-bit RGB patterns) without type-switching on the concrete driver.
+type Capabilities struct {
+	// TachReader indicates the driver can read back fan RPM via a tachometer signal
+	TachReader bool
+	// PerFanPWM indicates the driver can drive individual fans independently rather than a single shared PWM line
+	PerFanPWM bool
+	// RGBTopLED indicates the top LED supports full 24-bit RGB rather than a fixed color set
+	RGBTopLED bool
+	// PoEClassNegotiation indicates the driver can negotiate/report 802.3at PoE power class
+	PoEClassNegotiation bool
+}
+
+// CapabilitiesProvider is implemented by ComputeBladeHal drivers that can report their supported feature set.
+// It is kept separate from ComputeBladeHal so existing drivers keep compiling without implementing it.
+type CapabilitiesProvider interface {
+	Capabilities() Capabilities
+}
+
+// DriverFactory constructs a ComputeBladeHal for a given set of options. Drivers register one via Register.
+type DriverFactory func(opts ComputeBladeHalOpts) (ComputeBladeHal, error)
+
+// DriverRegistry is a lookup of HardwareProfile to DriverFactory, mirroring the driver-map pattern used by
+// multi-bridge lighting servers to support several hardware backends behind one interface.
+type DriverRegistry struct {
+	mu      sync.RWMutex
+	drivers map[HardwareProfile]DriverFactory
+}
+
+// defaultRegistry is the process-wide registry drivers register themselves against from an init() function.
+var defaultRegistry = &DriverRegistry{drivers: make(map[HardwareProfile]DriverFactory)}
+
+// Register adds a driver factory for the given hardware profile to the default registry.
+// It is meant to be called from a driver package's init() function.
+func Register(profile HardwareProfile, factory DriverFactory) {
+	defaultRegistry.Register(profile, factory)
+}
+
+// New looks up and constructs the driver for the given hardware profile in the default registry.
+func New(profile HardwareProfile, opts ComputeBladeHalOpts) (ComputeBladeHal, error) {
+	return defaultRegistry.New(profile, opts)
+}
+
+// Register adds a driver factory for the given hardware profile.
+func (r *DriverRegistry) Register(profile HardwareProfile, factory DriverFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.drivers[profile] = factory
+}
+
+// New looks up and constructs the driver for the given hardware profile.
+func (r *DriverRegistry) New(profile HardwareProfile, opts ComputeBladeHalOpts) (ComputeBladeHal, error) {
+	r.mu.RLock()
+	factory, ok := r.drivers[profile]
+	registered := r.profilesLocked()
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("hal: no driver registered for hardware profile %q (registered: %v)", profile, registered)
+	}
+	return factory(opts)
+}
+
+// Profiles returns the hardware profiles with a registered driver, sorted for stable output. Useful for
+// surfacing what a given build actually supports, since HardwareProfile consts can exist ahead of a driver.
+func (r *DriverRegistry) Profiles() []HardwareProfile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.profilesLocked()
+}
+
+func (r *DriverRegistry) profilesLocked() []HardwareProfile {
+	profiles := make([]HardwareProfile, 0, len(r.drivers))
+	for profile := range r.drivers {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i] < profiles[j] })
+	return profiles
+}
+
+// Profiles returns the hardware profiles with a registered driver in the default registry.
+func Profiles() []HardwareProfile {
+	return defaultRegistry.Profiles()
+}
@@ -0,0 +1,65 @@
+// Package mqttbridge forwards ComputeBladeAgent events onto an MQTT broker, one topic per event type, so a
+// cluster-wide controller can react to events (e.g. EdgeButtonEvent, CriticalEvent) from many blades.
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/xvzf/computeblade-agent/internal/agent"
+)
+
+// Publisher is the minimal MQTT client surface the bridge needs, satisfied by e.g. an eclipse/paho client.
+type Publisher interface {
+	Publish(topic string, payload []byte) error
+}
+
+// Opts configures Run.
+type Opts struct {
+	// Agent is the agent whose events are forwarded
+	Agent agent.ComputeBladeAgent
+	// Publisher is the MQTT client events are published through
+	Publisher Publisher
+	// TopicPrefix is prepended to "/<event-type>" to form the published topic, e.g. "computeblade/rack1-blade3"
+	TopicPrefix string
+	// Filter optionally restricts which events are forwarded. A nil filter forwards everything.
+	Filter agent.EventFilter
+}
+
+// payload is the JSON body published for every event
+type payload struct {
+	BladeID   string `json:"blade_id"`
+	Event     string `json:"event"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Run subscribes to opts.Agent's event bus and publishes every matching event to MQTT, one topic per event
+// type, until ctx is canceled.
+func Run(ctx context.Context, opts Opts) error {
+	events, cancel := opts.Agent.WatchEvents(ctx, opts.Filter)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case envelope, ok := <-events:
+			if !ok {
+				return nil
+			}
+			body, err := json.Marshal(payload{
+				BladeID:   envelope.BladeID,
+				Event:     envelope.Event.String(),
+				Timestamp: envelope.Timestamp.Format("2006-01-02T15:04:05.000Z07:00"),
+			})
+			if err != nil {
+				return err
+			}
+			topic := fmt.Sprintf("%s/%s", opts.TopicPrefix, envelope.Event.String())
+			if err := opts.Publisher.Publish(topic, body); err != nil {
+				return err
+			}
+		}
+	}
+}